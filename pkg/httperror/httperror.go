@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
+	"sync"
 
 	"github.com/segmentio/encoding/json"
 	"github.com/uptrace/bun/driver/pgdriver"
@@ -20,6 +23,26 @@ var ErrRequestTimeout = New(http.StatusRequestTimeout,
 type Error interface {
 	error
 	HTTPStatusCode() int
+
+	// WithDetail attaches a key/value pair to the error's Details map and
+	// returns the error so calls can be chained.
+	WithDetail(key string, value any) Error
+
+	// WithFieldError appends a per-field validation error and returns the
+	// error so calls can be chained.
+	WithFieldError(field, code, message string) Error
+
+	// WithFieldErrors appends zero or more per-field validation errors and
+	// returns the error so calls can be chained.
+	WithFieldErrors(fields ...FieldError) Error
+}
+
+// FieldError describes a validation error scoped to a single request field,
+// e.g. a span-search filter or an alert-rule form field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 //------------------------------------------------------------------------------
@@ -32,26 +55,57 @@ func Wrap(err error) Error {
 
 type wrappedError struct {
 	error
+
+	details     map[string]any
+	fieldErrors []FieldError
 }
 
 func (e wrappedError) HTTPStatusCode() int {
 	return http.StatusBadRequest
 }
 
+func (e wrappedError) WithDetail(key string, value any) Error {
+	details := make(map[string]any, len(e.details)+1)
+	for k, v := range e.details {
+		details[k] = v
+	}
+	details[key] = value
+	e.details = details
+	return e
+}
+
+func (e wrappedError) WithFieldError(field, code, message string) Error {
+	return e.WithFieldErrors(FieldError{Field: field, Code: code, Message: message})
+}
+
+func (e wrappedError) WithFieldErrors(fields ...FieldError) Error {
+	e.fieldErrors = append(e.fieldErrors[:len(e.fieldErrors):len(e.fieldErrors)], fields...)
+	return e
+}
+
 func (e wrappedError) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]any{
+	m := map[string]any{
 		"status":  e.HTTPStatusCode(),
 		"code":    "bad_request",
 		"message": e.Error(),
-	})
+	}
+	if len(e.details) > 0 {
+		m["details"] = e.details
+	}
+	if len(e.fieldErrors) > 0 {
+		m["fieldErrors"] = e.fieldErrors
+	}
+	return json.Marshal(m)
 }
 
 //------------------------------------------------------------------------------
 
 type httpError struct {
-	Status  int    `json:"status"`
-	Code    string `json:"code"`
-	Message string `json:"message"`
+	Status      int            `json:"status"`
+	Code        string         `json:"code"`
+	Message     string         `json:"message"`
+	Details     map[string]any `json:"details,omitempty"`
+	FieldErrors []FieldError   `json:"fieldErrors,omitempty"`
 }
 
 func (e *httpError) HTTPStatusCode() int {
@@ -62,6 +116,27 @@ func (e *httpError) Error() string {
 	return e.Message
 }
 
+func (e *httpError) WithDetail(key string, value any) Error {
+	details := make(map[string]any, len(e.Details)+1)
+	for k, v := range e.Details {
+		details[k] = v
+	}
+	details[key] = value
+	clone := *e
+	clone.Details = details
+	return &clone
+}
+
+func (e *httpError) WithFieldError(field, code, message string) Error {
+	return e.WithFieldErrors(FieldError{Field: field, Code: code, Message: message})
+}
+
+func (e *httpError) WithFieldErrors(fields ...FieldError) Error {
+	clone := *e
+	clone.FieldErrors = append(e.FieldErrors[:len(e.FieldErrors):len(e.FieldErrors)], fields...)
+	return &clone
+}
+
 //------------------------------------------------------------------------------
 
 func New(status int, code, msg string, args ...any) Error {
@@ -99,6 +174,59 @@ func Timeout(msg string, args ...any) Error {
 	return New(http.StatusGatewayTimeout, "timeout", msg, args...)
 }
 
+// Validation returns an Error carrying one or more per-field validation
+// failures, e.g. from a span-search filter or alert-rule form.
+func Validation(fields ...FieldError) Error {
+	return New(http.StatusUnprocessableEntity, "validation", "Validation failed").
+		WithFieldErrors(fields...)
+}
+
+//------------------------------------------------------------------------------
+
+// Mapper converts err into an Error. It returns ok == false when it does not
+// know how to handle err, in which case From tries the next mapper.
+type Mapper func(err error) (Error, bool)
+
+type registeredMapper struct {
+	priority int
+	mapper   Mapper
+}
+
+var (
+	mappersMu sync.Mutex
+	mappers   []registeredMapper
+)
+
+// Register adds a Mapper that From consults after its built-in type switch
+// (Error, JSON, strconv, pgdriver and ClickHouse errors) and before its
+// remaining built-in fallbacks. Mappers are tried in priority order (highest first);
+// mappers registered with the same priority are tried in registration order.
+// This lets other packages (S3, gRPC, Redis clients, etc.) plug in their own
+// error->HTTP conversions without editing this package.
+func Register(priority int, mapper Mapper) {
+	mappersMu.Lock()
+	defer mappersMu.Unlock()
+
+	mappers = append(mappers, registeredMapper{priority: priority, mapper: mapper})
+	sort.SliceStable(mappers, func(i, j int) bool {
+		return mappers[i].priority > mappers[j].priority
+	})
+}
+
+func fromRegistry(err error) (Error, bool) {
+	mappersMu.Lock()
+	snapshot := make([]registeredMapper, len(mappers))
+	copy(snapshot, mappers)
+	mappersMu.Unlock()
+
+	for _, m := range snapshot {
+		if httpErr, ok := m.mapper(err); ok {
+			return httpErr, true
+		}
+	}
+	return nil, false
+}
+
 //------------------------------------------------------------------------------
 
 var errType = reflect.TypeOf(errors.New(""))
@@ -110,7 +238,8 @@ func From(err error) Error {
 	case *json.SyntaxError:
 		return BadRequest("json_syntax", err.Error())
 	case *json.UnmarshalTypeError:
-		return BadRequest("json_unmarshal", err.Error())
+		return BadRequest("json_unmarshal", err.Error()).
+			WithFieldError(err.Field, "json_unmarshal", err.Error())
 	case *strconv.NumError:
 		return BadRequest("strconv_num", err.Error())
 	case pgdriver.Error:
@@ -122,6 +251,10 @@ func From(err error) Error {
 		return internalError(err)
 	}
 
+	if httpErr, ok := fromRegistry(err); ok {
+		return httpErr
+	}
+
 	msg := err.Error()
 
 	if msg == "http: request body too large" {
@@ -151,5 +284,14 @@ func From(err error) Error {
 
 func internalError(err error) Error {
 	typ := reflect.TypeOf(err).String()
-	return InternalServerError(typ + ": " + err.Error())
+	sanitized := redact(typ + ": " + err.Error())
+	correlationID := newCorrelationID()
+
+	slog.Error("internal error", "correlation_id", correlationID, "error", sanitized)
+
+	msg := "internal server error"
+	if Debug {
+		msg = sanitized
+	}
+	return InternalServerError(msg).WithDetail("correlationId", correlationID)
 }
@@ -0,0 +1,80 @@
+package httperror
+
+import (
+	"errors"
+	"testing"
+)
+
+// withMappers saves and restores the package-level mapper registry so tests
+// can register their own without leaking into other tests.
+func withMappers(t *testing.T, fn func()) {
+	t.Helper()
+	mappersMu.Lock()
+	saved := mappers
+	mappers = nil
+	mappersMu.Unlock()
+
+	t.Cleanup(func() {
+		mappersMu.Lock()
+		mappers = saved
+		mappersMu.Unlock()
+	})
+
+	fn()
+}
+
+func TestRegisterPriorityOrder(t *testing.T) {
+	withMappers(t, func() {
+		var order []string
+
+		Register(0, func(err error) (Error, bool) {
+			order = append(order, "low")
+			return BadRequest("low", "low"), true
+		})
+		Register(10, func(err error) (Error, bool) {
+			order = append(order, "high")
+			return BadRequest("high", "high"), true
+		})
+		Register(5, func(err error) (Error, bool) {
+			order = append(order, "mid")
+			return BadRequest("mid", "mid"), true
+		})
+
+		httpErr, ok := fromRegistry(errors.New("boom"))
+		if !ok {
+			t.Fatalf("fromRegistry returned ok=false")
+		}
+		if httpErr.Error() != "high" {
+			t.Fatalf("fromRegistry returned %q, want the highest-priority mapper's result", httpErr.Error())
+		}
+		if len(order) != 1 || order[0] != "high" {
+			t.Fatalf("mappers invoked = %v, want only the highest-priority one tried first", order)
+		}
+	})
+}
+
+func TestRegisterPriorityTieBreak(t *testing.T) {
+	withMappers(t, func() {
+		var order []string
+
+		Register(5, func(err error) (Error, bool) {
+			order = append(order, "first")
+			return nil, false
+		})
+		Register(5, func(err error) (Error, bool) {
+			order = append(order, "second")
+			return BadRequest("second", "second"), true
+		})
+
+		httpErr, ok := fromRegistry(errors.New("boom"))
+		if !ok {
+			t.Fatalf("fromRegistry returned ok=false")
+		}
+		if httpErr.Error() != "second" {
+			t.Fatalf("fromRegistry returned %q, want the second mapper's result", httpErr.Error())
+		}
+		if len(order) != 2 || order[0] != "first" || order[1] != "second" {
+			t.Fatalf("mappers invoked in order %v, want same-priority mappers tried in registration order", order)
+		}
+	})
+}
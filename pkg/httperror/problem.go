@@ -0,0 +1,125 @@
+package httperror
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// ProblemContentType is the media type for RFC 7807 Problem Details
+// responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 (https://www.rfc-editor.org/rfc/rfc7807)
+// representation of an Error.
+type Problem struct {
+	Type     string `json:"-"`
+	Title    string `json:"-"`
+	Status   int    `json:"-"`
+	Detail   string `json:"-"`
+	Instance string `json:"-"`
+
+	// Extensions holds additional members merged into the top-level problem
+	// object, e.g. "code", "details", "fieldErrors".
+	Extensions map[string]any `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	m["title"] = p.Title
+	m["status"] = p.Status
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// ToProblem converts err into an RFC 7807 Problem Details value. instance is
+// typically the request path and is used as the "instance" member.
+func ToProblem(err Error, instance string) Problem {
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(err.HTTPStatusCode()),
+		Status:   err.HTTPStatusCode(),
+		Detail:   err.Error(),
+		Instance: instance,
+	}
+
+	if pe, ok := err.(problemExtender); ok {
+		if ext := pe.problemExtensions(); len(ext) > 0 {
+			problem.Extensions = ext
+		}
+	}
+	return problem
+}
+
+// problemExtender is implemented by Error types that carry extra fields
+// (code, details, field errors) to surface as Problem.Extensions, so
+// ToProblem doesn't lose data that the plain-JSON encoding already exposes.
+type problemExtender interface {
+	problemExtensions() map[string]any
+}
+
+func (e *httpError) problemExtensions() map[string]any {
+	ext := make(map[string]any)
+	if e.Code != "" {
+		ext["code"] = e.Code
+	}
+	if len(e.Details) > 0 {
+		ext["details"] = e.Details
+	}
+	if len(e.FieldErrors) > 0 {
+		ext["fieldErrors"] = e.FieldErrors
+	}
+	return ext
+}
+
+func (e wrappedError) problemExtensions() map[string]any {
+	ext := map[string]any{"code": "bad_request"}
+	if len(e.details) > 0 {
+		ext["details"] = e.details
+	}
+	if len(e.fieldErrors) > 0 {
+		ext["fieldErrors"] = e.fieldErrors
+	}
+	return ext
+}
+
+// WriteProblem writes err to w. If the request's Accept header lists
+// application/problem+json (q-values and the order of entries are not
+// considered), the RFC 7807 representation is written;
+// otherwise the existing Uptrace-shaped error body is used.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	httpErr := From(err)
+
+	if !acceptsProblemJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(httpErr.HTTPStatusCode())
+		_ = json.NewEncoder(w).Encode(httpErr)
+		return
+	}
+
+	problem := ToProblem(httpErr, r.URL.Path)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+func acceptsProblemJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if strings.HasPrefix(strings.TrimSpace(part), ProblemContentType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package httperror
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestToProblemExtensionsHTTPError(t *testing.T) {
+	err := NotFound("span not found").
+		WithDetail("traceId", "abc123").
+		WithFieldError("spanId", "missing", "span id is required")
+
+	problem := ToProblem(err, "/api/v1/spans/abc123")
+
+	if problem.Status != http.StatusNotFound {
+		t.Fatalf("Status = %d, want %d", problem.Status, http.StatusNotFound)
+	}
+	if problem.Extensions["code"] != "not_found" {
+		t.Fatalf("Extensions[code] = %v, want %q", problem.Extensions["code"], "not_found")
+	}
+	details, _ := problem.Extensions["details"].(map[string]any)
+	if details["traceId"] != "abc123" {
+		t.Fatalf("Extensions[details] = %v, want traceId=abc123", problem.Extensions["details"])
+	}
+	fieldErrors, _ := problem.Extensions["fieldErrors"].([]FieldError)
+	if len(fieldErrors) != 1 || fieldErrors[0].Field != "spanId" {
+		t.Fatalf("Extensions[fieldErrors] = %v, want one FieldError for spanId", problem.Extensions["fieldErrors"])
+	}
+}
+
+func TestToProblemExtensionsWrappedError(t *testing.T) {
+	err := Wrap(errors.New("invalid filter")).
+		WithDetail("filter", "duration>1s").
+		WithFieldError("filter", "invalid", "unsupported operator")
+
+	problem := ToProblem(err, "/api/v1/spans")
+
+	if problem.Extensions["code"] != "bad_request" {
+		t.Fatalf("Extensions[code] = %v, want %q", problem.Extensions["code"], "bad_request")
+	}
+	details, _ := problem.Extensions["details"].(map[string]any)
+	if details["filter"] != "duration>1s" {
+		t.Fatalf("Extensions[details] = %v, want filter=duration>1s", problem.Extensions["details"])
+	}
+	fieldErrors, _ := problem.Extensions["fieldErrors"].([]FieldError)
+	if len(fieldErrors) != 1 || fieldErrors[0].Field != "filter" {
+		t.Fatalf("Extensions[fieldErrors] = %v, want one FieldError for filter", problem.Extensions["fieldErrors"])
+	}
+}
+
+func TestToProblemNoDetailsOrFieldErrors(t *testing.T) {
+	err := Wrap(errors.New("plain error"))
+
+	problem := ToProblem(err, "/api/v1/spans")
+
+	if problem.Extensions["details"] != nil || problem.Extensions["fieldErrors"] != nil {
+		t.Fatalf("Extensions = %v, want no details/fieldErrors when none were set", problem.Extensions)
+	}
+}
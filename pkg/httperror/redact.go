@@ -0,0 +1,91 @@
+package httperror
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+// Debug controls whether internalError responses include the full sanitized
+// driver error message. Production deployments should leave this false so
+// clients only ever see a short opaque message plus a correlation ID, while
+// the full (redacted) message is logged server-side under the same ID.
+var Debug = false
+
+// Redactor scrubs sensitive fragments (SQL literals, table/column names,
+// tokens, emails, etc.) out of a driver error message before it is logged or
+// returned to a client.
+type Redactor func(msg string) string
+
+var redactors []Redactor
+
+// RegisterRedactor adds a Redactor that internalError runs, in registration
+// order, over every error message it handles before it is logged or
+// returned to a client. ClickHouse timeout errors do not go through
+// internalError and are not redacted.
+func RegisterRedactor(r Redactor) {
+	redactors = append(redactors, r)
+}
+
+func init() {
+	RegisterRedactor(redactDetailHint)
+	RegisterRedactor(redactQuotedLiterals)
+	RegisterRedactor(redactEmails)
+	RegisterRedactor(redactUUIDs)
+	RegisterRedactor(redactTokens)
+}
+
+var (
+	detailHintRe = regexp.MustCompile(`(?is)\b(DETAIL|HINT):.*`)
+	literalRe    = regexp.MustCompile(`'[^']*'`)
+	emailRe      = regexp.MustCompile(`[[:alnum:]._%+-]+@[[:alnum:].-]+\.[[:alpha:]]{2,}`)
+	// tokenRe matches common bearer/API-key shapes: "Bearer <token>",
+	// "api_key=<token>"/"token=<token>"/"secret=<token>"/"password=<token>",
+	// and bare alphanumeric runs long enough to be a secret rather than a word.
+	tokenRe = regexp.MustCompile(`(?i)\b(Bearer\s+[[:alnum:]._-]+|(?:api[_-]?key|token|secret|password)\s*[=:]\s*\S+|[[:alnum:]_-]{24,})\b`)
+	uuidRe  = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+)
+
+// redactDetailHint strips everything after a Postgres/ClickHouse "DETAIL:"
+// or "HINT:" marker, which commonly echoes back literal parameter values.
+func redactDetailHint(msg string) string {
+	return detailHintRe.ReplaceAllString(msg, "$1: [redacted]")
+}
+
+// redactQuotedLiterals replaces single-quoted SQL literals with a
+// placeholder so column values don't leak into responses or logs.
+func redactQuotedLiterals(msg string) string {
+	return literalRe.ReplaceAllString(msg, "'?'")
+}
+
+func redactEmails(msg string) string {
+	return emailRe.ReplaceAllString(msg, "[redacted-email]")
+}
+
+// redactTokens scrubs bearer tokens, API keys, and other long opaque
+// credential-shaped substrings that drivers sometimes echo back verbatim
+// (e.g. in a connection-string or header dump embedded in an error).
+func redactTokens(msg string) string {
+	return tokenRe.ReplaceAllString(msg, "[redacted-token]")
+}
+
+// redactUUIDs replaces UUIDs (e.g. primary/foreign key values surfaced in a
+// unique-constraint violation) with a placeholder.
+func redactUUIDs(msg string) string {
+	return uuidRe.ReplaceAllString(msg, "[redacted-uuid]")
+}
+
+func redact(msg string) string {
+	for _, r := range redactors {
+		msg = r(msg)
+	}
+	return msg
+}
+
+// newCorrelationID returns a short random ID that ties a sanitized client
+// response back to the full error logged server-side.
+func newCorrelationID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
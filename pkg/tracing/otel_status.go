@@ -0,0 +1,67 @@
+package tracing
+
+// OTel span status code strings, as reported by the OpenTelemetry SDKs.
+const (
+	OTelStatusCodeUnset = "Unset"
+	OTelStatusCodeOK    = "Ok"
+	OTelStatusCodeError = "Error"
+)
+
+// ApplyOTelStatus maps an OTel span status (code, msg) and the
+// exception.type, exception.message and exception.escaped attributes in attrs
+// onto StatusCode, StatusMessage and System; error.* attributes are not read.
+// It follows the OTel rule that an Unset status reported by an SDK never
+// downgrades a status already set to Error, and promotes the
+// exception.type/exception.message attributes into the span's top-level
+// StatusMessage. System is set to "log:error" when
+// exception.escaped=true so IsError reflects real OTel semantics rather than
+// only the hard-coded log:error|fatal|panic set.
+func (s *Span) ApplyOTelStatus(code, msg string, attrs AttrMap) {
+	switch code {
+	case OTelStatusCodeOK:
+		s.StatusCode = OKStatusCode
+		if msg != "" {
+			s.StatusMessage = msg
+		}
+	case OTelStatusCodeError:
+		s.StatusCode = ErrorStatusCode
+		if msg != "" {
+			s.StatusMessage = msg
+		}
+	default:
+		if s.StatusCode == "" {
+			s.StatusCode = StatusCodeUnset
+		}
+	}
+
+	excType, _ := attrs["exception.type"].(string)
+	excMsg, _ := attrs["exception.message"].(string)
+	switch {
+	case excType != "" && excMsg != "":
+		s.StatusMessage = excType + ": " + excMsg
+	case excType != "":
+		s.StatusMessage = excType
+	case excMsg != "":
+		s.StatusMessage = excMsg
+	}
+	if excType != "" || excMsg != "" {
+		s.StatusCode = ErrorStatusCode
+	}
+
+	if escaped, _ := attrs["exception.escaped"].(bool); escaped {
+		s.System = "log:error"
+	}
+}
+
+// ToOTelStatus derives the OTel status code/message that should be set on s
+// when re-exporting it, the inverse of ApplyOTelStatus.
+func (s *Span) ToOTelStatus() (code, msg string) {
+	switch s.StatusCode {
+	case OKStatusCode:
+		return OTelStatusCodeOK, s.StatusMessage
+	case ErrorStatusCode:
+		return OTelStatusCodeError, s.StatusMessage
+	default:
+		return OTelStatusCodeUnset, ""
+	}
+}
@@ -2,7 +2,10 @@ package tracing
 
 import (
 	"errors"
+	"fmt"
+	"iter"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/uptrace/pkg/idgen"
@@ -135,13 +138,21 @@ func (s *Span) TreeEndTime() time.Time {
 }
 
 var (
-	walkBreak     = errors.New("BREAK")
-	walkNextChild = errors.New("NEXT-CHILD")
+	// Stop aborts the traversal entirely. It is not returned as an error
+	// from Walk/WalkPostOrder.
+	Stop = errors.New("stop span walk")
+	// SkipChildren skips the current span's children but continues the
+	// traversal with its siblings.
+	SkipChildren = errors.New("skip span children")
 )
 
+// Walk visits s and its descendants pre-order, calling fn(child, parent) for
+// each span (parent is nil for s itself). Returning SkipChildren from fn
+// skips that span's subtree; returning Stop ends the traversal early;
+// returning any other error aborts Walk and is returned to the caller.
 func (s *Span) Walk(fn func(child, parent *Span) error) error {
 	if err := fn(s, nil); err != nil {
-		if err != walkBreak {
+		if err != Stop && err != SkipChildren {
 			return err
 		}
 		return nil
@@ -152,7 +163,7 @@ func (s *Span) Walk(fn func(child, parent *Span) error) error {
 func (s *Span) walkChildren(fn func(child, parent *Span) error) error {
 	for _, child := range s.Children {
 		if err := fn(child, s); err != nil {
-			if err == walkNextChild {
+			if err == SkipChildren {
 				continue
 			}
 			return err
@@ -164,6 +175,52 @@ func (s *Span) walkChildren(fn func(child, parent *Span) error) error {
 	return nil
 }
 
+// WalkPostOrder visits s and its descendants post-order (children before
+// their parent), calling fn(child, parent) for each span. This lets callers
+// compute DurationSelf or aggregate child metrics in a single pass. Returning
+// Stop ends the traversal early; SkipChildren has no effect since children
+// are already visited by the time fn runs for their parent.
+func (s *Span) WalkPostOrder(fn func(child, parent *Span) error) error {
+	err := s.walkChildrenPostOrder(fn)
+	if err != nil {
+		if err == Stop {
+			return nil
+		}
+		return err
+	}
+	if err := fn(s, nil); err != nil && err != Stop && err != SkipChildren {
+		return err
+	}
+	return nil
+}
+
+func (s *Span) walkChildrenPostOrder(fn func(child, parent *Span) error) error {
+	for _, child := range s.Children {
+		if err := child.walkChildrenPostOrder(fn); err != nil {
+			return err
+		}
+		if err := fn(child, s); err != nil && err != SkipChildren {
+			return err
+		}
+	}
+	return nil
+}
+
+// Iter returns a range-over-func iterator that yields (child, parent) pairs
+// pre-order, mirroring Walk. Breaking out of the range loop stops the
+// traversal early; there is no skip-children equivalent for range loops, use
+// Walk with SkipChildren for that.
+func (s *Span) Iter() iter.Seq2[*Span, *Span] {
+	return func(yield func(*Span, *Span) bool) {
+		_ = s.Walk(func(child, parent *Span) error {
+			if !yield(child, parent) {
+				return Stop
+			}
+			return nil
+		})
+	}
+}
+
 func (s *Span) AddChild(child *Span) {
 	s.Children = append(s.Children, child)
 }
@@ -174,7 +231,67 @@ func (s *Span) AddEvent(event *SpanEvent) {
 
 //------------------------------------------------------------------------------
 
-func buildSpanTree(spans []*Span) (*Span, int) {
+// DefaultFakeRootDisplayName is the DisplayName given to the synthetic root
+// span created when a batch has no span with ParentID == 0. It can be
+// overridden per call via WithFakeRootDisplayName.
+const DefaultFakeRootDisplayName = "The span is missing. Make sure to configure the upstream service to report to Uptrace, end spans on all conditions, and shut down OpenTelemetry when the app exits."
+
+// ParentLookup resolves the trace ID a span ID belongs to when that span
+// isn't present in the current batch, e.g. because its parent arrived in an
+// earlier ClickHouse insert. It is consulted for spans whose ParentID can't
+// be found locally; a found trace ID only changes the DisplayName of the
+// orphan placeholder, and the spans are still grouped under it.
+type ParentLookup interface {
+	LookupTraceID(spanID idgen.SpanID) (idgen.TraceID, bool)
+}
+
+type buildSpanTreeConfig struct {
+	parentLookup        ParentLookup
+	fakeRootDisplayName string
+}
+
+// BuildSpanTreeOption customizes buildSpanTree.
+type BuildSpanTreeOption func(*buildSpanTreeConfig)
+
+// WithParentLookup sets the cache consulted for spans whose parent is
+// missing from the current batch.
+func WithParentLookup(lookup ParentLookup) BuildSpanTreeOption {
+	return func(cfg *buildSpanTreeConfig) {
+		cfg.parentLookup = lookup
+	}
+}
+
+// WithFakeRootDisplayName overrides DefaultFakeRootDisplayName for this call.
+func WithFakeRootDisplayName(name string) BuildSpanTreeOption {
+	return func(cfg *buildSpanTreeConfig) {
+		cfg.fakeRootDisplayName = name
+	}
+}
+
+var (
+	orphanSpansTotal atomic.Int64
+	cycleSpansTotal  atomic.Int64
+)
+
+// OrphanSpansTotal returns the number of spans seen so far whose ParentID
+// could not be resolved within their batch (tracing.orphan_spans_total).
+// The count is kept in process memory and is read only through this
+// function; this package does not register it with a metrics exporter.
+func OrphanSpansTotal() int64 { return orphanSpansTotal.Load() }
+
+// CycleSpansTotal returns the number of spans seen so far that were
+// re-parented to break a cycle in their ancestor chain, one per broken cycle
+// (tracing.cycle_spans_total). The count is kept in process memory and is
+// read only through this function; this package does not register it with a
+// metrics exporter.
+func CycleSpansTotal() int64 { return cycleSpansTotal.Load() }
+
+func buildSpanTree(spans []*Span, opts ...BuildSpanTreeOption) (*Span, int) {
+	var cfg buildSpanTreeConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	var root *Span
 	m := make(map[idgen.SpanID]*Span, len(spans))
 
@@ -192,9 +309,13 @@ func buildSpanTree(spans []*Span) (*Span, int) {
 	}
 
 	if root == nil {
-		root = newFakeRoot(spans[0])
+		root = newFakeRoot(spans[0], cfg.fakeRootDisplayName)
 	}
 
+	breakCycles(m, root)
+
+	orphans := make(map[idgen.SpanID]*Span)
+
 	for _, s := range spans {
 		if s.IsEvent() {
 			if span, ok := m[s.ParentID]; ok {
@@ -215,7 +336,11 @@ func buildSpanTree(spans []*Span) (*Span, int) {
 
 		parent := m[s.ParentID]
 		if parent == nil {
-			parent = root
+			if s.ParentID == root.ID {
+				parent = root
+			} else {
+				parent = orphanParent(s.ParentID, orphans, root, cfg.parentLookup)
+			}
 		}
 		parent.AddChild(s)
 	}
@@ -223,7 +348,102 @@ func buildSpanTree(spans []*Span) (*Span, int) {
 	return root, len(m) + 1
 }
 
-func newFakeRoot(sample *Span) *Span {
+// breakCycles breaks each cycle in the ParentID chains by clearing the
+// ParentID of one span in the cycle, so that buildSpanTree attaches that span
+// to root and later tree traversals (Walk, TreeEndTime) can't recurse
+// forever. The moved span gets a StatusMessage annotation explaining why it
+// moved, unless it already has a StatusMessage; the other cycle members keep
+// their parents.
+func breakCycles(m map[idgen.SpanID]*Span, root *Span) {
+	const (
+		unvisited uint8 = iota
+		visiting
+		done
+	)
+	state := make(map[idgen.SpanID]uint8, len(m))
+
+	var visit func(id idgen.SpanID)
+	visit = func(id idgen.SpanID) {
+		s, ok := m[id]
+		if !ok || state[id] == done {
+			return
+		}
+		if state[id] == visiting {
+			s.ParentID = 0
+			if s.StatusMessage == "" {
+				s.StatusMessage = "Detected a cycle in the parent chain; reparented to the trace root."
+			}
+			cycleSpansTotal.Add(1)
+			state[id] = done
+			return
+		}
+
+		state[id] = visiting
+		if s.ParentID == id {
+			s.ParentID = 0
+			if s.StatusMessage == "" {
+				s.StatusMessage = "Detected a cycle in the parent chain; reparented to the trace root."
+			}
+			cycleSpansTotal.Add(1)
+			state[id] = done
+			return
+		}
+		if s.ParentID != 0 {
+			visit(s.ParentID)
+		}
+		state[id] = done
+	}
+
+	for id := range m {
+		visit(id)
+	}
+}
+
+// orphanParent returns the span that orphans of missingParentID should be
+// attached to. Orphans sharing the same missing parent are grouped under one
+// synthetic placeholder (rather than flooding root individually) so the
+// resulting tree stays readable.
+func orphanParent(
+	missingParentID idgen.SpanID, orphans map[idgen.SpanID]*Span, root *Span, lookup ParentLookup,
+) *Span {
+	orphanSpansTotal.Add(1)
+
+	if placeholder, ok := orphans[missingParentID]; ok {
+		return placeholder
+	}
+
+	placeholder := &Span{
+		ID:        idgen.RandSpanID(),
+		ParentID:  root.ID,
+		TraceID:   root.TraceID,
+		ProjectID: root.ProjectID,
+		Type:      TypeSpanFuncs,
+		System:    TypeSpanFuncs + ":" + SystemUnknown,
+		Kind:      SpanKindInternal,
+
+		Name:        "orphan",
+		DisplayName: fmt.Sprintf("Spans whose parent %s could not be found", missingParentID),
+		Time:        root.Time,
+		StatusCode:  StatusCodeUnset,
+		Attrs:       make(AttrMap),
+	}
+	if lookup != nil {
+		if traceID, ok := lookup.LookupTraceID(missingParentID); ok {
+			placeholder.DisplayName = fmt.Sprintf(
+				"Spans whose parent %s belongs to trace %s, which hasn't arrived yet",
+				missingParentID, traceID)
+		}
+	}
+
+	orphans[missingParentID] = placeholder
+	root.AddChild(placeholder)
+	return placeholder
+}
+
+func newFakeRoot(sample *Span, displayName string) *Span {
+	if displayName == "" {
+		displayName = DefaultFakeRootDisplayName
+	}
 	span := &Span{
 		ID:      idgen.RandSpanID(),
 		TraceID: sample.TraceID,
@@ -234,7 +454,7 @@ func newFakeRoot(sample *Span) *Span {
 		Kind:      SpanKindInternal,
 
 		Name:        "unknown",
-		DisplayName: "The span is missing. Make sure to configure the upstream service to report to Uptrace, end spans on all conditions, and shut down OpenTelemetry when the app exits.",
+		DisplayName: displayName,
 		Time:        sample.Time,
 		StatusCode:  StatusCodeUnset,
 		Attrs:       make(AttrMap),
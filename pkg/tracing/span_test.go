@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/uptrace/pkg/idgen"
+)
+
+func TestBuildSpanTreeCycles(t *testing.T) {
+	tests := []struct {
+		name     string
+		spans    []*Span
+		cycleIDs []idgen.SpanID // spans that form the cycle in the input
+	}{
+		{
+			name: "self loop",
+			spans: []*Span{
+				{ID: 1, ParentID: 0},
+				{ID: 2, ParentID: 2},
+			},
+			cycleIDs: []idgen.SpanID{2},
+		},
+		{
+			name: "multi span cycle",
+			spans: []*Span{
+				{ID: 1, ParentID: 0},
+				{ID: 2, ParentID: 3},
+				{ID: 3, ParentID: 4},
+				{ID: 4, ParentID: 2},
+			},
+			cycleIDs: []idgen.SpanID{2, 3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, _ := buildSpanTree(tt.spans)
+
+			// breakCycles must have reparented at least one span in the
+			// cycle to root, otherwise the ParentID chain still loops.
+			var reparented int
+			for _, s := range tt.spans {
+				for _, id := range tt.cycleIDs {
+					if s.ID == id && s.ParentID == root.ID {
+						reparented++
+					}
+				}
+			}
+			if reparented == 0 {
+				t.Fatalf("no span in the cycle was reparented to root %d", root.ID)
+			}
+
+			// The reparented span must be a direct child of root, not
+			// wrapped in a synthetic orphan placeholder underneath it.
+			rootChildren := make(map[idgen.SpanID]bool, len(root.Children))
+			for _, c := range root.Children {
+				rootChildren[c.ID] = true
+			}
+			var directChild bool
+			for _, s := range tt.spans {
+				for _, id := range tt.cycleIDs {
+					if s.ID == id && s.ParentID == root.ID && rootChildren[s.ID] {
+						directChild = true
+					}
+				}
+			}
+			if !directChild {
+				t.Fatalf("reparented span is not a direct child of root; root.Children = %v", root.Children)
+			}
+
+			// Walking the tree must terminate even though the input had a
+			// cycle; a span must never end up as its own descendant.
+			var walked int
+			if err := root.Walk(func(child, parent *Span) error {
+				walked++
+				if walked > len(tt.spans)+1 {
+					return Stop
+				}
+				return nil
+			}); err != nil {
+				t.Fatalf("Walk returned error: %v", err)
+			}
+			if walked > len(tt.spans)+1 {
+				t.Fatalf("Walk visited more spans than exist, tree likely still cyclic")
+			}
+		})
+	}
+}
+
+func TestWalkPostOrderSkipChildren(t *testing.T) {
+	root := &Span{ID: 1}
+	skipMe := &Span{ID: 2}
+	grandchild := &Span{ID: 3}
+	skipMe.AddChild(grandchild)
+	sibling := &Span{ID: 4}
+	root.AddChild(skipMe)
+	root.AddChild(sibling)
+
+	var visited []idgen.SpanID
+	err := root.WalkPostOrder(func(child, parent *Span) error {
+		visited = append(visited, child.ID)
+		if child.ID == skipMe.ID {
+			return SkipChildren
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkPostOrder returned error: %v", err)
+	}
+
+	want := []idgen.SpanID{3, 2, 4, 1}
+	if len(visited) != len(want) {
+		t.Fatalf("visited = %v, want %v", visited, want)
+	}
+	for i, id := range want {
+		if visited[i] != id {
+			t.Fatalf("visited = %v, want %v", visited, want)
+		}
+	}
+}